@@ -0,0 +1,18 @@
+package api
+
+// ErrorCode is a stable, machine-readable identifier attached to an
+// HTTPError so that SDKs can switch on it instead of matching against the
+// human-readable message, which is free to change wording over time.
+type ErrorCode string
+
+const (
+	ErrorCodeMFAFactorTypeUnsupported ErrorCode = "mfa_factor_type_unsupported"
+	ErrorCodeMFAEnrollmentDisabled    ErrorCode = "mfa_enrollment_disabled"
+	ErrorCodeMFAVerificationDisabled  ErrorCode = "mfa_verification_disabled"
+	ErrorCodeTooManyEnrolledFactors   ErrorCode = "too_many_enrolled_mfa_factors"
+	ErrorCodeMFAChallengeExpired      ErrorCode = "mfa_challenge_expired"
+	ErrorCodeMFAIPAddressMismatch     ErrorCode = "mfa_ip_address_mismatch"
+	ErrorCodeMFAInvalidCode           ErrorCode = "mfa_invalid_code"
+	ErrorCodeUserSSOManaged           ErrorCode = "user_sso_managed"
+	ErrorCodeValidationFailed         ErrorCode = "validation_failed"
+)
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// HTTPError is the JSON body gotrue returns for every non-2xx API response.
+// Message is the human-readable description; ErrorCode is an
+// optional machine-readable identifier for handlers that want to key
+// client-side behavior off something more durable than the message text.
+type HTTPError struct {
+	Code          int       `json:"code"`
+	ErrorCode     ErrorCode `json:"error_code,omitempty"`
+	Message       string    `json:"msg"`
+	InternalError error     `json:"-"`
+	InternalMsg   string    `json:"-"`
+}
+
+func (e *HTTPError) Error() string {
+	if e.InternalMsg != "" {
+		return e.InternalMsg
+	}
+	return e.Message
+}
+
+// Cause allows the pkg/errors Cause() convention to unwrap to whatever
+// internal error, if any, produced this HTTPError.
+func (e *HTTPError) Cause() error {
+	if e.InternalError != nil {
+		return e.InternalError
+	}
+	return e
+}
+
+// WithInternalError attaches the underlying error for logging purposes
+// without changing the message returned to the client.
+func (e *HTTPError) WithInternalError(err error) *HTTPError {
+	e.InternalError = err
+	e.InternalMsg = err.Error()
+	return e
+}
+
+// WithInternalMessage sets additional internal context for logging.
+func (e *HTTPError) WithInternalMessage(fmtString string, args ...interface{}) *HTTPError {
+	e.InternalMsg = fmt.Sprintf(fmtString, args...)
+	return e
+}
+
+// WithCode attaches a stable ErrorCode to the error response.
+func (e *HTTPError) WithCode(code ErrorCode) *HTTPError {
+	e.ErrorCode = code
+	return e
+}
+
+func httpError(code int, fmtString string, args ...interface{}) *HTTPError {
+	return &HTTPError{
+		Code:    code,
+		Message: fmt.Sprintf(fmtString, args...),
+	}
+}
+
+func badRequestError(fmtString string, args ...interface{}) *HTTPError {
+	return httpError(http.StatusBadRequest, fmtString, args...)
+}
+
+func internalServerError(fmtString string, args ...interface{}) *HTTPError {
+	return httpError(http.StatusInternalServerError, fmtString, args...)
+}
+
+func notFoundError(fmtString string, args ...interface{}) *HTTPError {
+	return httpError(http.StatusNotFound, fmtString, args...)
+}
+
+func forbiddenError(fmtString string, args ...interface{}) *HTTPError {
+	return httpError(http.StatusForbidden, fmtString, args...)
+}
+
+func unprocessableEntityError(fmtString string, args ...interface{}) *HTTPError {
+	return httpError(http.StatusUnprocessableEntity, fmtString, args...)
+}
@@ -2,8 +2,10 @@ package api
 
 import (
 	"bytes"
+	"crypto/rand"
 	"encoding/json"
 	"fmt"
+	"math/big"
 	"net/http"
 	"time"
 
@@ -15,20 +17,46 @@ import (
 	"github.com/go-webauthn/webauthn/protocol"
 	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/conf"
 	"github.com/netlify/gotrue/metering"
 	"github.com/netlify/gotrue/models"
 	"github.com/netlify/gotrue/storage"
 	"github.com/netlify/gotrue/utilities"
 	"github.com/pquerna/otp/totp"
-	"github.com/mitchellh/mapstructure"
 )
 
+// phoneOTPLength is the number of digits in a phone MFA challenge code.
+const phoneOTPLength = 6
+
 const DefaultQRSize = 3
 
+// Defaults applied when an operator leaves MFA.RecoveryCodes.Count/Length
+// unset (zero value), so a missing config can never result in generating
+// zero codes or zero-length (i.e. empty string) codes.
+const (
+	defaultRecoveryCodesCount  = 10
+	defaultRecoveryCodesLength = 8
+)
+
+// recoveryCodesParams returns the configured recovery code count/length,
+// falling back to the documented defaults if either is left unset.
+func recoveryCodesParams(config *conf.GlobalConfiguration) (int, int) {
+	count := config.MFA.RecoveryCodes.Count
+	if count <= 0 {
+		count = defaultRecoveryCodesCount
+	}
+	length := config.MFA.RecoveryCodes.Length
+	if length <= 0 {
+		length = defaultRecoveryCodesLength
+	}
+	return count, length
+}
+
 type EnrollFactorParams struct {
 	FriendlyName string `json:"friendly_name"`
 	FactorType   string `json:"factor_type"`
 	Issuer       string `json:"issuer"`
+	Phone        string `json:"phone"`
 }
 
 type TOTPObject struct {
@@ -38,9 +66,10 @@ type TOTPObject struct {
 }
 
 type EnrollFactorResponse struct {
-	ID   uuid.UUID  `json:"id"`
-	Type string     `json:"type"`
-	TOTP TOTPObject `json:"totp,omitempty"`
+	ID       uuid.UUID                    `json:"id"`
+	Type     string                       `json:"type"`
+	TOTP     TOTPObject                   `json:"totp,omitempty"`
+	WebAuthn *protocol.CredentialCreation `json:"webauthn,omitempty"`
 }
 
 type VerifyFactorParams struct {
@@ -57,7 +86,18 @@ type UnenrollFactorResponse struct {
 	ID uuid.UUID `json:"id"`
 }
 
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
 
+func (a *API) newWebAuthn() (*webauthn.WebAuthn, error) {
+	config := a.config
+	return webauthn.New(&webauthn.Config{
+		RPDisplayName: config.MFA.WebAuthn.RPDisplayName,
+		RPID:          config.MFA.WebAuthn.RPID,
+		RPOrigins:     config.MFA.WebAuthn.RPOrigins,
+	})
+}
 
 func (a *API) EnrollFactor(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
@@ -76,15 +116,24 @@ func (a *API) EnrollFactor(w http.ResponseWriter, r *http.Request) error {
 	}
 
 	if user.IsSSOUser {
-		return unprocessableEntityError("MFA enrollment only supported for non-SSO users at this time")
+		return unprocessableEntityError("MFA enrollment only supported for non-SSO users at this time").WithCode(ErrorCodeUserSSOManaged)
 	}
 
 	factorType := params.FactorType
-	if factorType == "webauthn" {
+	if factorType == models.WebAuthn {
 		return a.EnrollWebAuthnFactor(w, r)
 	}
+	if factorType == models.Phone {
+		return a.EnrollPhoneFactor(w, r)
+	}
+	if factorType == models.Recovery {
+		return a.EnrollRecoveryFactor(w, r)
+	}
 	if factorType != models.TOTP {
-		return badRequestError("factor_type needs to be totp")
+		return badRequestError("factor_type needs to be totp").WithCode(ErrorCodeMFAFactorTypeUnsupported)
+	}
+	if !config.MFA.TOTP.EnrollEnabled {
+		return forbiddenError("TOTP enrollment is disabled").WithCode(ErrorCodeMFAEnrollmentDisabled)
 	}
 
 	if params.Issuer == "" {
@@ -104,7 +153,7 @@ func (a *API) EnrollFactor(w http.ResponseWriter, r *http.Request) error {
 	}
 
 	if len(factors) >= int(config.MFA.MaxEnrolledFactors) {
-		return forbiddenError("Enrolled factors exceed allowed limit, unenroll to continue")
+		return forbiddenError("Enrolled factors exceed allowed limit, unenroll to continue").WithCode(ErrorCodeTooManyEnrolledFactors)
 	}
 	numVerifiedFactors := 0
 
@@ -114,7 +163,7 @@ func (a *API) EnrollFactor(w http.ResponseWriter, r *http.Request) error {
 		}
 	}
 	if numVerifiedFactors >= config.MFA.MaxVerifiedFactors {
-		return forbiddenError("Maximum number of enrolled factors reached, unenroll to continue")
+		return forbiddenError("Maximum number of enrolled factors reached, unenroll to continue").WithCode(ErrorCodeTooManyEnrolledFactors)
 	}
 
 	key, err := totp.Generate(totp.GenerateOpts{
@@ -166,24 +215,18 @@ func (a *API) EnrollFactor(w http.ResponseWriter, r *http.Request) error {
 }
 
 func (a *API) EnrollWebAuthnFactor(w http.ResponseWriter, r *http.Request) error {
-	// Initialize webauthn object and set it on the global context
 	ctx := r.Context()
 	user := getUser(ctx)
-	session := getSession(ctx)
+	config := a.config
 
-	web, err := webauthn.New(&webauthn.Config{
-		RPDisplayName: "Go Webauthn",                        // Display Name for your site
-		RPID:          "2175-203-116-4-74.ap.ngrok.io",                  // Generally the FQDN for your site
-		RPOrigin:      "https://2175-203-116-4-74.ap.ngrok.io",    // The origin URL for WebAuthn requests
-		RPIcon:        "https://go-webauthn.local/logo.png", // Optional icon URL for your site
-	})
-	if err != nil {
-		return err
+	if user.IsSSOUser {
+		return unprocessableEntityError("MFA enrollment only supported for non-SSO users at this time").WithCode(ErrorCodeUserSSOManaged)
+	}
+	if !config.MFA.WebAuthn.EnrollEnabled {
+		return forbiddenError("WebAuthn enrollment is disabled").WithCode(ErrorCodeMFAEnrollmentDisabled)
 	}
 
 	params := &EnrollFactorParams{}
-	config := a.config
-	// issuer := ""
 	body, err := getBodyBytes(r)
 	if err != nil {
 		return internalServerError("Could not read body").WithInternalError(err)
@@ -193,17 +236,6 @@ func (a *API) EnrollWebAuthnFactor(w http.ResponseWriter, r *http.Request) error
 		return badRequestError("invalid body: unable to parse JSON").WithInternalError(err)
 	}
 
-	// TODO(Joel): Factor this check into a function
-	// if params.Issuer == "" {
-	// 	u, err := url.ParseRequestURI(config.SiteURL)
-	// 	if err != nil {
-	// 		return internalServerError("site url is improperly formatted")
-	// 	}
-	// 	issuer = u.Host
-	// } else {
-	// 	issuer = params.Issuer
-	// }
-
 	// Read from DB for certainty
 	factors, err := models.FindFactorsByUser(a.db, user)
 	if err != nil {
@@ -211,31 +243,39 @@ func (a *API) EnrollWebAuthnFactor(w http.ResponseWriter, r *http.Request) error
 	}
 
 	if len(factors) >= int(config.MFA.MaxEnrolledFactors) {
-		return forbiddenError("Enrolled factors exceed allowed limit, unenroll to continue")
+		return forbiddenError("Enrolled factors exceed allowed limit, unenroll to continue").WithCode(ErrorCodeTooManyEnrolledFactors)
 	}
 	numVerifiedFactors := 0
 
-	// TODO: Remove this at v2
 	for _, factor := range factors {
 		if factor.Status == models.FactorStateVerified.String() {
 			numVerifiedFactors += 1
 		}
-
 	}
-	if numVerifiedFactors >= 1 {
-		return forbiddenError("number of enrolled factors exceeds the allowed value, unenroll to continue")
+	if numVerifiedFactors >= config.MFA.MaxVerifiedFactors {
+		return forbiddenError("Maximum number of enrolled factors reached, unenroll to continue").WithCode(ErrorCodeTooManyEnrolledFactors)
+	}
 
+	web, err := a.newWebAuthn()
+	if err != nil {
+		return internalServerError("error initializing webauthn provider").WithInternalError(err)
 	}
-	// TODO (Joel): Properly populate the secret field
-	factor, err := models.NewFactor(user, params.FriendlyName, params.FactorType, models.FactorStateUnverified, "")
+
+	factor, err := models.NewFactor(user, params.FriendlyName, models.WebAuthn, models.FactorStateUnverified, "")
 	if err != nil {
 		return internalServerError("database error creating factor").WithInternalError(err)
 	}
+
+	creation, sessionData, err := web.BeginRegistration(&models.WebauthnUser{User: user})
+	if err != nil {
+		return internalServerError("error starting webauthn registration").WithInternalError(err)
+	}
+
 	err = a.db.Transaction(func(tx *storage.Connection) error {
 		if terr := tx.Create(factor); terr != nil {
 			return terr
 		}
-		if terr := session.UpdateWebauthnConfiguration(tx, web); terr != nil {
+		if terr := models.SetWebauthnSessionData(tx, factor.ID, models.WebauthnRegistration, sessionData); terr != nil {
 			return terr
 		}
 		if terr := models.NewAuditLogEntry(r, tx, user, models.EnrollFactorAction, r.RemoteAddr, map[string]interface{}{
@@ -249,36 +289,69 @@ func (a *API) EnrollWebAuthnFactor(w http.ResponseWriter, r *http.Request) error
 		return err
 	}
 
-	return sendJSON(w, http.StatusOK, factor)
+	return sendJSON(w, http.StatusOK, &EnrollFactorResponse{
+		ID:       factor.ID,
+		Type:     models.WebAuthn,
+		WebAuthn: creation,
+	})
 }
 
-func (a *API) ChallengeFactor(w http.ResponseWriter, r *http.Request) error {
+func (a *API) EnrollPhoneFactor(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
+	user := getUser(ctx)
 	config := a.config
 
-	user := getUser(ctx)
-	factor := getFactor(ctx)
-	ipAddress := utilities.GetIPAddress(r)
-	challenge, err := models.NewChallenge(factor, ipAddress)
+	if user.IsSSOUser {
+		return unprocessableEntityError("MFA enrollment only supported for non-SSO users at this time").WithCode(ErrorCodeUserSSOManaged)
+	}
+	if !config.MFA.Phone.EnrollEnabled {
+		return forbiddenError("Phone enrollment is disabled").WithCode(ErrorCodeMFAEnrollmentDisabled)
+	}
+
+	params := &EnrollFactorParams{}
+	body, err := getBodyBytes(r)
 	if err != nil {
-		return internalServerError("Database error creating challenge").WithInternalError(err)
+		return internalServerError("Could not read body").WithInternalError(err)
 	}
 
-	// TODO(Joel): replace hardcoded string with actual value
-	if factor.FactorType == "webauthn" {
-		return a.ChallengeWebAuthnFactor(w, r)
-		
+	if err := json.Unmarshal(body, params); err != nil {
+		return badRequestError("invalid body: unable to parse JSON").WithInternalError(err)
+	}
+
+	if params.Phone == "" {
+		return badRequestError("phone number is required to enroll a phone factor").WithCode(ErrorCodeValidationFailed)
+	}
+
+	// Read from DB for certainty
+	factors, err := models.FindFactorsByUser(a.db, user)
+	if err != nil {
+		return internalServerError("error validating number of factors in system").WithInternalError(err)
+	}
+
+	if len(factors) >= int(config.MFA.MaxEnrolledFactors) {
+		return forbiddenError("Enrolled factors exceed allowed limit, unenroll to continue").WithCode(ErrorCodeTooManyEnrolledFactors)
+	}
+	numVerifiedFactors := 0
 
+	for _, factor := range factors {
+		if factor.Status == models.FactorStateVerified.String() {
+			numVerifiedFactors += 1
+		}
+	}
+	if numVerifiedFactors >= config.MFA.MaxVerifiedFactors {
+		return forbiddenError("Maximum number of enrolled factors reached, unenroll to continue").WithCode(ErrorCodeTooManyEnrolledFactors)
 	}
 
+	factor, err := models.NewFactor(user, params.FriendlyName, models.Phone, models.FactorStateUnverified, params.Phone)
+	if err != nil {
+		return internalServerError("database error creating factor").WithInternalError(err)
+	}
 	err = a.db.Transaction(func(tx *storage.Connection) error {
-		if terr := tx.Create(challenge); terr != nil {
+		if terr := tx.Create(factor); terr != nil {
 			return terr
 		}
-
-		if terr := models.NewAuditLogEntry(r, tx, user, models.CreateChallengeAction, r.RemoteAddr, map[string]interface{}{
-			"factor_id":     factor.ID,
-			"factor_status": factor.Status,
+		if terr := models.NewAuditLogEntry(r, tx, user, models.EnrollFactorAction, r.RemoteAddr, map[string]interface{}{
+			"factor_id": factor.ID,
 		}); terr != nil {
 			return terr
 		}
@@ -288,72 +361,86 @@ func (a *API) ChallengeFactor(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
-	creationTime := challenge.CreatedAt
-	expiryTime := creationTime.Add(time.Second * time.Duration(config.MFA.ChallengeExpiryDuration))
-	return sendJSON(w, http.StatusOK, &ChallengeFactorResponse{
-		ID:        challenge.ID,
-		ExpiresAt: expiryTime.Unix(),
+	return sendJSON(w, http.StatusOK, &EnrollFactorResponse{
+		ID:   factor.ID,
+		Type: models.Phone,
 	})
 }
 
-func (a *API) ChallengeWebAuthnFactor(w http.ResponseWriter, r *http.Request) error {
-	// Returns the public key and related information
+// EnrollRecoveryFactor generates a fresh set of single-use recovery codes
+// for the user, handling POST /factors/recovery. Unlike the other factor
+// types, a recovery factor is created already verified: the codes
+// themselves, once shown, are the proof of possession. Generating a set
+// requires at least one other verified primary factor to already exist, so
+// recovery codes can never be the user's sole second factor. If the user
+// already has a recovery factor (e.g. this endpoint was called twice), the
+// existing factor is reused and its codes replaced rather than creating a
+// second "recovery" factor row.
+func (a *API) EnrollRecoveryFactor(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
 	user := getUser(ctx)
-	session := getSession(ctx)
-	factor := getFactor(ctx)
-	ipAddress := utilities.GetIPAddress(r)
-	challenge, err := models.NewChallenge(factor, ipAddress)
-	web := &webauthn.WebAuthn{}
+	config := a.config
 
-	// TODO(Joel): Substitute this with a webauthn config read from the db
-	webMarshaled := session.WebauthnConfiguration
+	if user.IsSSOUser {
+		return unprocessableEntityError("MFA enrollment only supported for non-SSO users at this time").WithCode(ErrorCodeUserSSOManaged)
+	}
 
-	err = mapstructure.Decode(webMarshaled, web)
+	factors, err := models.FindFactorsByUser(a.db, user)
 	if err != nil {
-		return err
+		return internalServerError("error validating number of factors in system").WithInternalError(err)
 	}
 
-	// Registration session
-	registrationSession := session.WebauthnRegistrationSession
-	// TODO(Joel) - Properly check if registrationSession is empty,
-	if registrationSession == nil {
-		// Registration has been initiated
-		options, sessionData, err := web.BeginLogin(user)
-		if err != nil {
-			return err
+	hasPrimaryFactor := false
+	var factor *models.Factor
+	for _, f := range factors {
+		if f.Status == models.FactorStateVerified.String() && (f.FactorType == models.TOTP || f.FactorType == models.WebAuthn) {
+			hasPrimaryFactor = true
 		}
-		err = a.db.Transaction(func(tx *storage.Connection) error {
-			if terr := session.UpdateWebauthnLoginSession(tx, sessionData); terr != nil {
-				return terr
-			}
-			return nil
-		})
-		return sendJSON(w, http.StatusOK, options)
-
-	} else {
+		if f.FactorType == models.Recovery {
+			factor = f
+		}
+	}
+	if !hasPrimaryFactor {
+		return unprocessableEntityError("At least one verified TOTP or WebAuthn factor is required before generating recovery codes")
+	}
 
-		options, sessionData, err := web.BeginRegistration(user)
+	isNewFactor := factor == nil
+	if isNewFactor {
+		if len(factors) >= int(config.MFA.MaxEnrolledFactors) {
+			return forbiddenError("Enrolled factors exceed allowed limit, unenroll to continue").WithCode(ErrorCodeTooManyEnrolledFactors)
+		}
+		factor, err = models.NewFactor(user, "Recovery codes", models.Recovery, models.FactorStateVerified, "")
 		if err != nil {
-			return err
+			return internalServerError("database error creating factor").WithInternalError(err)
 		}
+	}
 
-		err = a.db.Transaction(func(tx *storage.Connection) error {
-			if terr := session.UpdateWebauthnRegistrationSession(tx, sessionData); terr != nil {
-				return terr
-			}
-			return nil
-		})
+	count, length := recoveryCodesParams(config)
+	codes, err := models.GenerateRecoveryCodes(count, length)
+	if err != nil {
+		return internalServerError("error generating recovery codes").WithInternalError(err)
+	}
 
-		// Registration case
 	err = a.db.Transaction(func(tx *storage.Connection) error {
-		if terr := tx.Create(challenge); terr != nil {
+		if terr := models.DeleteRecoveryCodesByUser(tx, user.ID); terr != nil {
 			return terr
 		}
-
-		if terr := models.NewAuditLogEntry(r, tx, user, models.CreateChallengeAction, r.RemoteAddr, map[string]interface{}{
-			"factor_id":     factor.ID,
-			"factor_status": factor.Status,
+		if isNewFactor {
+			if terr := tx.Create(factor); terr != nil {
+				return terr
+			}
+		}
+		for _, code := range codes {
+			record, terr := models.NewRecoveryCode(user.ID, code)
+			if terr != nil {
+				return terr
+			}
+			if terr := tx.Create(record); terr != nil {
+				return terr
+			}
+		}
+		if terr := models.NewAuditLogEntry(r, tx, user, models.RecoveryCodesGeneratedAction, r.RemoteAddr, map[string]interface{}{
+			"factor_id": factor.ID,
 		}); terr != nil {
 			return terr
 		}
@@ -362,185 +449,763 @@ func (a *API) ChallengeWebAuthnFactor(w http.ResponseWriter, r *http.Request) er
 	if err != nil {
 		return err
 	}
-		fmt.Printf("reached\n")
-		fmt.Printf("%+v\n", options)
-
-		return sendJSON(w, http.StatusOK,*options)
-	}
 
+	return sendJSON(w, http.StatusOK, &RecoveryCodesResponse{
+		RecoveryCodes: codes,
+	})
 }
 
-func (a *API) VerifyFactor(w http.ResponseWriter, r *http.Request) error {
-	var err error
+// RegenerateRecoveryFactor invalidates a user's existing recovery codes and
+// issues a fresh set, handling POST /factors/recovery/regenerate. Since this
+// discards working codes, it requires the session to already be at AAL2.
+func (a *API) RegenerateRecoveryFactor(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
 	user := getUser(ctx)
-	factor := getFactor(ctx)
+	session := getSession(ctx)
 	config := a.config
 
-	params := &VerifyFactorParams{}
-	currentIP := utilities.GetIPAddress(r)
-
-	body, err := getBodyBytes(r)
-	if err != nil {
-		return internalServerError("Could not read body").WithInternalError(err)
-	}
-
-	if err := json.Unmarshal(body, params); err != nil {
-		return badRequestError("invalid body: unable to parse JSON").WithInternalError(err)
-	}
-
-	if factor.UserID != user.ID {
-		return internalServerError("user needs to own factor to verify")
+	if session.GetAAL() != models.AAL2.String() {
+		return forbiddenError("AAL2 required to regenerate recovery codes")
 	}
 
-	challenge, err := models.FindChallengeByChallengeID(a.db, params.ChallengeID)
+	factors, err := models.FindFactorsByUser(a.db, user)
 	if err != nil {
-		if models.IsNotFoundError(err) {
-			return notFoundError(err.Error())
-		}
-		return internalServerError("Database error finding Challenge").WithInternalError(err)
-	}
-
-	if challenge.VerifiedAt != nil || challenge.IPAddress != currentIP {
-		return badRequestError("Challenge and verify IP addresses mismatch")
+		return internalServerError("error validating number of factors in system").WithInternalError(err)
 	}
 
-	hasExpired := time.Now().After(challenge.CreatedAt.Add(time.Second * time.Duration(config.MFA.ChallengeExpiryDuration)))
-	if hasExpired {
-		err := a.db.Transaction(func(tx *storage.Connection) error {
-			if terr := tx.Destroy(challenge); terr != nil {
-				return internalServerError("Database error deleting challenge").WithInternalError(terr)
-			}
-
-			return nil
-		})
-		if err != nil {
-			return err
+	var factor *models.Factor
+	for _, f := range factors {
+		if f.FactorType == models.Recovery {
+			factor = f
+			break
 		}
-		return badRequestError("%v has expired, verify against another challenge or create a new challenge.", challenge.ID)
 	}
-	if factor.FactorType == "webauthn" {
-		return a.VerifyWebAuthnFactor(w, r)
+	if factor == nil {
+		return notFoundError("No recovery codes have been generated for this user")
 	}
 
-	if valid := totp.Validate(params.Code, factor.Secret); !valid {
-		return badRequestError("Invalid TOTP code entered")
+	count, length := recoveryCodesParams(config)
+	codes, err := models.GenerateRecoveryCodes(count, length)
+	if err != nil {
+		return internalServerError("error generating recovery codes").WithInternalError(err)
 	}
 
-	var token *AccessTokenResponse
 	err = a.db.Transaction(func(tx *storage.Connection) error {
-		var terr error
-		if terr = models.NewAuditLogEntry(r, tx, user, models.VerifyFactorAction, r.RemoteAddr, map[string]interface{}{
-			"factor_id":    factor.ID,
-			"challenge_id": challenge.ID,
-		}); terr != nil {
-			return terr
-		}
-		if terr = challenge.Verify(tx); terr != nil {
+		if terr := models.DeleteRecoveryCodesByUser(tx, user.ID); terr != nil {
 			return terr
 		}
-		if factor.Status != models.FactorStateVerified.String() {
-			if terr = factor.UpdateStatus(tx, models.FactorStateVerified); terr != nil {
+		for _, code := range codes {
+			record, terr := models.NewRecoveryCode(user.ID, code)
+			if terr != nil {
+				return terr
+			}
+			if terr := tx.Create(record); terr != nil {
 				return terr
 			}
 		}
-		user, terr = models.FindUserByID(tx, user.ID)
-		if terr != nil {
-			return terr
-		}
-		token, terr = a.updateMFASessionAndClaims(r, tx, user, models.TOTPSignIn, models.GrantParams{
-			FactorID: &factor.ID,
-		})
-		if terr != nil {
+		if terr := models.NewAuditLogEntry(r, tx, user, models.RecoveryCodesGeneratedAction, r.RemoteAddr, map[string]interface{}{
+			"factor_id": factor.ID,
+		}); terr != nil {
 			return terr
 		}
-		if terr = a.setCookieTokens(config, token, false, w); terr != nil {
-			return internalServerError("Failed to set JWT cookie. %s", terr)
-		}
-		if terr = models.InvalidateSessionsWithAALLessThan(tx, user.ID, models.AAL2.String()); terr != nil {
-			return internalServerError("Failed to update sessions. %s", terr)
-		}
-		if terr = models.DeleteUnverifiedFactors(tx, user); terr != nil {
-			return internalServerError("Error removing unverified factors. %s", terr)
-		}
 		return nil
 	})
 	if err != nil {
 		return err
 	}
-	metering.RecordLogin(string(models.MFACodeLoginAction), user.ID)
-
-	return sendJSON(w, http.StatusOK, token)
 
+	return sendJSON(w, http.StatusOK, &RecoveryCodesResponse{
+		RecoveryCodes: codes,
+	})
 }
 
-func (a *API) VerifyWebAuthnFactor(w http.ResponseWriter, r *http.Request) error {
-	sessionData := &webauthn.SessionData{}
+func (a *API) ChallengeFactor(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
-	user := getUser(ctx)
-	session := getSession(ctx)
+	config := a.config
 
-	web := &webauthn.WebAuthn{}
-	webMarshaled := session.WebauthnConfiguration
+	user := getUser(ctx)
+	factor := getFactor(ctx)
 
-	err := mapstructure.Decode(webMarshaled, web)
-	if err != nil {
-		return err
+	if factor.FactorType == models.WebAuthn {
+		return a.ChallengeWebAuthnFactor(w, r)
 	}
-
-
-	body, err := getBodyBytes(r)
-	if err != nil {
-		return internalServerError("Could not read body").WithInternalError(err)
+	if factor.FactorType == models.Phone {
+		return a.ChallengePhoneFactor(w, r)
 	}
-	params := &protocol.ParsedCredentialCreationData{}
-
-	if err := json.Unmarshal(body, params); err != nil {
-		return badRequestError("invalid body: unable to parse JSON").WithInternalError(err)
+	if factor.FactorType == models.Recovery {
+		return a.ChallengeRecoveryFactor(w, r)
 	}
-	fmt.Println(params)
-	// Login Session:
-	loginSession := session.WebauthnLoginSession
-	registrationSession := session.WebauthnRegistrationSession
-
-	parsedResponse, err := protocol.ParseCredentialCreationResponseBody(r.Body)
-	credential, err := web.CreateCredential(user, *sessionData, parsedResponse)
-	fmt.Println(credential)
-    /**
-	type ParsedCredentialCreationData struct {
-	ParsedPublicKeyCredential
-	Response ParsedAttestationResponse
-	Raw      CredentialCreationResponse
+	if !config.MFA.TOTP.VerifyEnabled {
+		return forbiddenError("TOTP verification is disabled").WithCode(ErrorCodeMFAVerificationDisabled)
 	}
-	**/
 
-	if registrationSession != nil {
-		parsedResponse, err := protocol.ParseCredentialCreationResponseBody(r.Body)
+	ipAddress := utilities.GetIPAddress(r)
+	challenge, err := models.NewChallenge(factor, ipAddress)
 	if err != nil {
-		return err
+		return internalServerError("Database error creating challenge").WithInternalError(err)
 	}
-	// Decision 1: Generic methods for login/registration sessions or separate ones?
-	credential, err := web.CreateCredential(user, *sessionData, parsedResponse)
+
+	err = a.db.Transaction(func(tx *storage.Connection) error {
+		if terr := tx.Create(challenge); terr != nil {
+			return terr
+		}
+
+		if terr := models.NewAuditLogEntry(r, tx, user, models.CreateChallengeAction, r.RemoteAddr, map[string]interface{}{
+			"factor_id":     factor.ID,
+			"factor_status": factor.Status,
+		}); terr != nil {
+			return terr
+		}
+		return nil
+	})
 	if err != nil {
 		return err
 	}
-	fmt.Println(credential)
-	} else if loginSession != nil {
-		parsedResponse, err := protocol.ParseCredentialRequestResponseBody(r.Body)
-		if err != nil {
-			return err
-		}
-		credential, err := web.ValidateLogin(user, *sessionData, parsedResponse)
-		fmt.Println(credential)
-	} else {
-		return internalServerError("Please initiate a webauthn session")
+
+	creationTime := challenge.CreatedAt
+	expiryTime := creationTime.Add(time.Second * time.Duration(config.MFA.ChallengeExpiryDuration))
+	return sendJSON(w, http.StatusOK, &ChallengeFactorResponse{
+		ID:        challenge.ID,
+		ExpiresAt: expiryTime.Unix(),
+	})
+}
+
+func (a *API) ChallengeWebAuthnFactor(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	user := getUser(ctx)
+	factor := getFactor(ctx)
+	config := a.config
+	ipAddress := utilities.GetIPAddress(r)
+
+	if !config.MFA.WebAuthn.VerifyEnabled {
+		return forbiddenError("WebAuthn verification is disabled").WithCode(ErrorCodeMFAVerificationDisabled)
+	}
+
+	web, err := a.newWebAuthn()
+	if err != nil {
+		return internalServerError("error initializing webauthn provider").WithInternalError(err)
+	}
+
+	webauthnUser, err := models.NewWebauthnUser(a.db, user)
+	if err != nil {
+		return internalServerError("error loading webauthn credentials").WithInternalError(err)
+	}
+
+	assertion, sessionData, err := web.BeginLogin(webauthnUser)
+	if err != nil {
+		return internalServerError("error starting webauthn login").WithInternalError(err)
+	}
+
+	challenge, err := models.NewChallenge(factor, ipAddress)
+	if err != nil {
+		return internalServerError("Database error creating challenge").WithInternalError(err)
+	}
+
+	err = a.db.Transaction(func(tx *storage.Connection) error {
+		if terr := tx.Create(challenge); terr != nil {
+			return terr
+		}
+		if terr := models.SetWebauthnSessionData(tx, factor.ID, models.WebauthnLogin, sessionData); terr != nil {
+			return terr
+		}
+		if terr := models.NewAuditLogEntry(r, tx, user, models.CreateChallengeAction, r.RemoteAddr, map[string]interface{}{
+			"factor_id":     factor.ID,
+			"factor_status": factor.Status,
+		}); terr != nil {
+			return terr
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return sendJSON(w, http.StatusOK, assertion)
+}
+
+func (a *API) ChallengePhoneFactor(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	config := a.config
+	user := getUser(ctx)
+	factor := getFactor(ctx)
+	ipAddress := utilities.GetIPAddress(r)
+
+	if !config.MFA.Phone.VerifyEnabled {
+		return forbiddenError("Phone verification is disabled").WithCode(ErrorCodeMFAVerificationDisabled)
+	}
+
+	// Rate limit per-user rather than per-factor: otherwise a user could
+	// enroll multiple unverified phone factors and round-robin challenges
+	// across them to send unlimited SMS.
+	userFactors, err := models.FindFactorsByUser(a.db, user)
+	if err != nil {
+		return internalServerError("error validating number of factors in system").WithInternalError(err)
+	}
+	var phoneFactorIDs []uuid.UUID
+	for _, f := range userFactors {
+		if f.FactorType == models.Phone {
+			phoneFactorIDs = append(phoneFactorIDs, f.ID)
+		}
+	}
+
+	last, err := models.FindLatestPhoneChallengeByFactorIDs(a.db, phoneFactorIDs)
+	if err != nil {
+		if _, ok := err.(models.PhoneChallengeNotFoundError); !ok {
+			return internalServerError("Database error checking phone challenge frequency").WithInternalError(err)
+		}
+	} else if time.Since(last.CreatedAt) < config.MFA.Phone.MaxFrequency {
+		return forbiddenError("A phone challenge has already been sent recently, please wait before requesting another")
+	}
+
+	challenge, err := models.NewChallenge(factor, ipAddress)
+	if err != nil {
+		return internalServerError("Database error creating challenge").WithInternalError(err)
+	}
+
+	otp, err := generatePhoneOTP()
+	if err != nil {
+		return internalServerError("error generating phone otp").WithInternalError(err)
+	}
+
+	phoneChallenge, err := models.NewPhoneChallenge(challenge.ID, factor.ID, otp)
+	if err != nil {
+		return internalServerError("error hashing phone otp").WithInternalError(err)
+	}
+
+	err = a.db.Transaction(func(tx *storage.Connection) error {
+		if terr := tx.Create(challenge); terr != nil {
+			return terr
+		}
+		if terr := tx.Create(phoneChallenge); terr != nil {
+			return terr
+		}
+		if terr := a.sms_provider.SendSms(factor.Secret, fmt.Sprintf("Your verification code is: %s", otp)); terr != nil {
+			return internalServerError("Error sending phone otp").WithInternalError(terr)
+		}
+		if terr := models.NewAuditLogEntry(r, tx, user, models.PhoneChallengeSentAction, r.RemoteAddr, map[string]interface{}{
+			"factor_id": factor.ID,
+		}); terr != nil {
+			return terr
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	creationTime := challenge.CreatedAt
+	expiryTime := creationTime.Add(time.Second * time.Duration(config.MFA.ChallengeExpiryDuration))
+	return sendJSON(w, http.StatusOK, &ChallengeFactorResponse{
+		ID:        challenge.ID,
+		ExpiresAt: expiryTime.Unix(),
+	})
+}
+
+// ChallengeRecoveryFactor exists only to give recovery codes a consistent
+// factor_type dispatch point alongside TOTP/WebAuthn/Phone. Recovery codes
+// have no separate challenge step: the codes were already handed to the
+// user at generation time, so clients should call VerifyFactor directly.
+func (a *API) ChallengeRecoveryFactor(w http.ResponseWriter, r *http.Request) error {
+	return badRequestError("Recovery codes do not support a challenge step, call verify directly with a code").WithCode(ErrorCodeMFAFactorTypeUnsupported)
+}
+
+// generatePhoneOTP returns a random numeric one-time code of
+// phoneOTPLength digits, suitable for sending over SMS.
+func generatePhoneOTP() (string, error) {
+	const digits = "0123456789"
+	otp := make([]byte, phoneOTPLength)
+	for i := range otp {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(digits))))
+		if err != nil {
+			return "", err
+		}
+		otp[i] = digits[n.Int64()]
+	}
+	return string(otp), nil
+}
+
+func (a *API) VerifyFactor(w http.ResponseWriter, r *http.Request) error {
+	var err error
+	ctx := r.Context()
+	user := getUser(ctx)
+	factor := getFactor(ctx)
+	config := a.config
+
+	if factor.FactorType == models.WebAuthn {
+		return a.VerifyWebAuthnFactor(w, r)
+	}
+	if factor.FactorType == models.Phone {
+		return a.VerifyPhoneFactor(w, r)
+	}
+	if factor.FactorType == models.Recovery {
+		return a.VerifyRecoveryFactor(w, r)
+	}
+	if !config.MFA.TOTP.VerifyEnabled {
+		return forbiddenError("TOTP verification is disabled").WithCode(ErrorCodeMFAVerificationDisabled)
+	}
+
+	params := &VerifyFactorParams{}
+	currentIP := utilities.GetIPAddress(r)
+
+	body, err := getBodyBytes(r)
+	if err != nil {
+		return internalServerError("Could not read body").WithInternalError(err)
+	}
+
+	if err := json.Unmarshal(body, params); err != nil {
+		return badRequestError("invalid body: unable to parse JSON").WithInternalError(err)
+	}
+
+	if factor.UserID != user.ID {
+		return internalServerError("user needs to own factor to verify")
+	}
+
+	challenge, err := models.FindChallengeByChallengeID(a.db, params.ChallengeID)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return notFoundError(err.Error())
+		}
+		return internalServerError("Database error finding Challenge").WithInternalError(err)
+	}
+
+	if challenge.VerifiedAt != nil || challenge.IPAddress != currentIP {
+		return badRequestError("Challenge and verify IP addresses mismatch").WithCode(ErrorCodeMFAIPAddressMismatch)
+	}
+
+	hasExpired := time.Now().After(challenge.CreatedAt.Add(time.Second * time.Duration(config.MFA.ChallengeExpiryDuration)))
+	if hasExpired {
+		err := a.db.Transaction(func(tx *storage.Connection) error {
+			if terr := tx.Destroy(challenge); terr != nil {
+				return internalServerError("Database error deleting challenge").WithInternalError(terr)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return badRequestError("%v has expired, verify against another challenge or create a new challenge.", challenge.ID).WithCode(ErrorCodeMFAChallengeExpired)
+	}
+
+	if valid := totp.Validate(params.Code, factor.Secret); !valid {
+		return badRequestError("Invalid TOTP code entered").WithCode(ErrorCodeMFAInvalidCode)
+	}
+
+	var token *AccessTokenResponse
+	err = a.db.Transaction(func(tx *storage.Connection) error {
+		var terr error
+		if terr = models.NewAuditLogEntry(r, tx, user, models.VerifyFactorAction, r.RemoteAddr, map[string]interface{}{
+			"factor_id":    factor.ID,
+			"challenge_id": challenge.ID,
+		}); terr != nil {
+			return terr
+		}
+		if terr = challenge.Verify(tx); terr != nil {
+			return terr
+		}
+		if factor.Status != models.FactorStateVerified.String() {
+			if terr = factor.UpdateStatus(tx, models.FactorStateVerified); terr != nil {
+				return terr
+			}
+		}
+		user, terr = models.FindUserByID(tx, user.ID)
+		if terr != nil {
+			return terr
+		}
+		token, terr = a.updateMFASessionAndClaims(r, tx, user, models.TOTPSignIn, models.GrantParams{
+			FactorID: &factor.ID,
+		})
+		if terr != nil {
+			return terr
+		}
+		if terr = a.setCookieTokens(config, token, false, w); terr != nil {
+			return internalServerError("Failed to set JWT cookie. %s", terr)
+		}
+		if terr = models.InvalidateSessionsWithAALLessThan(tx, user.ID, models.AAL2.String()); terr != nil {
+			return internalServerError("Failed to update sessions. %s", terr)
+		}
+		if terr = models.DeleteUnverifiedFactors(tx, user); terr != nil {
+			return internalServerError("Error removing unverified factors. %s", terr)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	metering.RecordLogin(string(models.MFACodeLoginAction), user.ID)
+
+	return sendJSON(w, http.StatusOK, token)
+
+}
+
+func (a *API) VerifyPhoneFactor(w http.ResponseWriter, r *http.Request) error {
+	var err error
+	ctx := r.Context()
+	user := getUser(ctx)
+	factor := getFactor(ctx)
+	config := a.config
+
+	if !config.MFA.Phone.VerifyEnabled {
+		return forbiddenError("Phone verification is disabled").WithCode(ErrorCodeMFAVerificationDisabled)
+	}
+
+	params := &VerifyFactorParams{}
+	currentIP := utilities.GetIPAddress(r)
+
+	body, err := getBodyBytes(r)
+	if err != nil {
+		return internalServerError("Could not read body").WithInternalError(err)
+	}
+
+	if err := json.Unmarshal(body, params); err != nil {
+		return badRequestError("invalid body: unable to parse JSON").WithInternalError(err)
+	}
+
+	if factor.UserID != user.ID {
+		return internalServerError("user needs to own factor to verify")
+	}
+
+	challenge, err := models.FindChallengeByChallengeID(a.db, params.ChallengeID)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return notFoundError(err.Error())
+		}
+		return internalServerError("Database error finding Challenge").WithInternalError(err)
+	}
+
+	if challenge.VerifiedAt != nil || challenge.IPAddress != currentIP {
+		return badRequestError("Challenge and verify IP addresses mismatch").WithCode(ErrorCodeMFAIPAddressMismatch)
+	}
+
+	hasExpired := time.Now().After(challenge.CreatedAt.Add(time.Second * time.Duration(config.MFA.ChallengeExpiryDuration)))
+	if hasExpired {
+		err := a.db.Transaction(func(tx *storage.Connection) error {
+			if terr := tx.Destroy(challenge); terr != nil {
+				return internalServerError("Database error deleting challenge").WithInternalError(terr)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return badRequestError("%v has expired, verify against another challenge or create a new challenge.", challenge.ID).WithCode(ErrorCodeMFAChallengeExpired)
+	}
+
+	phoneChallenge, err := models.FindPhoneChallengeByChallengeID(a.db, challenge.ID)
+	if err != nil {
+		return internalServerError("Database error finding phone challenge").WithInternalError(err)
+	}
+	if !phoneChallenge.VerifyOTP(params.Code) {
+		return badRequestError("Invalid phone OTP entered").WithCode(ErrorCodeMFAInvalidCode)
+	}
+
+	var token *AccessTokenResponse
+	err = a.db.Transaction(func(tx *storage.Connection) error {
+		var terr error
+		if terr = models.NewAuditLogEntry(r, tx, user, models.PhoneVerifiedAction, r.RemoteAddr, map[string]interface{}{
+			"factor_id":    factor.ID,
+			"challenge_id": challenge.ID,
+		}); terr != nil {
+			return terr
+		}
+		if terr = challenge.Verify(tx); terr != nil {
+			return terr
+		}
+		if factor.Status != models.FactorStateVerified.String() {
+			if terr = factor.UpdateStatus(tx, models.FactorStateVerified); terr != nil {
+				return terr
+			}
+		}
+		user, terr = models.FindUserByID(tx, user.ID)
+		if terr != nil {
+			return terr
+		}
+		token, terr = a.updateMFASessionAndClaims(r, tx, user, models.PhoneSignIn, models.GrantParams{
+			FactorID: &factor.ID,
+		})
+		if terr != nil {
+			return terr
+		}
+		if terr = a.setCookieTokens(config, token, false, w); terr != nil {
+			return internalServerError("Failed to set JWT cookie. %s", terr)
+		}
+		if terr = models.InvalidateSessionsWithAALLessThan(tx, user.ID, models.AAL2.String()); terr != nil {
+			return internalServerError("Failed to update sessions. %s", terr)
+		}
+		if terr = models.DeleteUnverifiedFactors(tx, user); terr != nil {
+			return internalServerError("Error removing unverified factors. %s", terr)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	metering.RecordLogin(string(models.MFACodeLoginAction), user.ID)
+
+	return sendJSON(w, http.StatusOK, token)
+}
+
+// VerifyRecoveryFactor redeems a single-use recovery code in place of a
+// challenge/verify pair, upgrading the session to AAL2 exactly like
+// TOTP/Phone/WebAuthn do once a matching code is found.
+func (a *API) VerifyRecoveryFactor(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	user := getUser(ctx)
+	factor := getFactor(ctx)
+	config := a.config
+
+	if factor.UserID != user.ID {
+		return internalServerError("user needs to own factor to verify")
+	}
+
+	params := &VerifyFactorParams{}
+	body, err := getBodyBytes(r)
+	if err != nil {
+		return internalServerError("Could not read body").WithInternalError(err)
+	}
+
+	if err := json.Unmarshal(body, params); err != nil {
+		return badRequestError("invalid body: unable to parse JSON").WithInternalError(err)
+	}
+
+	codes, err := models.FindValidRecoveryCodesByUser(a.db, user.ID)
+	if err != nil {
+		return internalServerError("Database error finding recovery codes").WithInternalError(err)
+	}
+
+	var matched *models.RecoveryCode
+	for _, code := range codes {
+		if code.VerifyCode(params.Code) {
+			matched = code
+			break
+		}
+	}
+	if matched == nil {
+		return badRequestError("Invalid recovery code entered").WithCode(ErrorCodeMFAInvalidCode)
+	}
+
+	var token *AccessTokenResponse
+	err = a.db.Transaction(func(tx *storage.Connection) error {
+		var terr error
+		if terr = models.NewAuditLogEntry(r, tx, user, models.RecoveryCodeUsedAction, r.RemoteAddr, map[string]interface{}{
+			"factor_id":        factor.ID,
+			"recovery_code_id": matched.ID,
+		}); terr != nil {
+			return terr
+		}
+		if terr = matched.MarkUsed(tx); terr != nil {
+			return terr
+		}
+		user, terr = models.FindUserByID(tx, user.ID)
+		if terr != nil {
+			return terr
+		}
+		token, terr = a.updateMFASessionAndClaims(r, tx, user, models.RecoverySignIn, models.GrantParams{
+			FactorID: &factor.ID,
+		})
+		if terr != nil {
+			return terr
+		}
+		if terr = a.setCookieTokens(config, token, false, w); terr != nil {
+			return internalServerError("Failed to set JWT cookie. %s", terr)
+		}
+		if terr = models.InvalidateSessionsWithAALLessThan(tx, user.ID, models.AAL2.String()); terr != nil {
+			return internalServerError("Failed to update sessions. %s", terr)
+		}
+		if terr = models.DeleteUnverifiedFactors(tx, user); terr != nil {
+			return internalServerError("Error removing unverified factors. %s", terr)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	metering.RecordLogin(string(models.MFACodeLoginAction), user.ID)
+
+	return sendJSON(w, http.StatusOK, token)
+}
+
+func (a *API) VerifyWebAuthnFactor(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	user := getUser(ctx)
+	factor := getFactor(ctx)
+	config := a.config
+
+	if factor.UserID != user.ID {
+		return internalServerError("user needs to own factor to verify")
+	}
+
+	// factor.Status is still unverified while finishing the registration
+	// ceremony started by EnrollWebAuthnFactor, so gate that leg on
+	// EnrollEnabled and only require VerifyEnabled for completing a login.
+	if factor.Status != models.FactorStateVerified.String() {
+		if !config.MFA.WebAuthn.EnrollEnabled {
+			return forbiddenError("WebAuthn enrollment is disabled").WithCode(ErrorCodeMFAEnrollmentDisabled)
+		}
+	} else if !config.MFA.WebAuthn.VerifyEnabled {
+		return forbiddenError("WebAuthn verification is disabled").WithCode(ErrorCodeMFAVerificationDisabled)
+	}
+
+	body, err := getBodyBytes(r)
+	if err != nil {
+		return internalServerError("Could not read body").WithInternalError(err)
+	}
+
+	web, err := a.newWebAuthn()
+	if err != nil {
+		return internalServerError("error initializing webauthn provider").WithInternalError(err)
+	}
+
+	if factor.Status != models.FactorStateVerified.String() {
+		return a.finishWebAuthnRegistration(r, w, body, web, user, factor)
+	}
+	return a.finishWebAuthnLogin(r, w, body, web, user, factor)
+}
+
+// finishWebAuthnRegistration completes the registration ceremony started by
+// EnrollWebAuthnFactor: it validates the attestation response against the
+// stored SessionData, persists the resulting credential, and marks the
+// factor verified. This does not by itself upgrade the session to AAL2 -
+// that only happens once the factor is used to complete a login.
+func (a *API) finishWebAuthnRegistration(r *http.Request, w http.ResponseWriter, body []byte, web *webauthn.WebAuthn, user *models.User, factor *models.Factor) error {
+	sessionData, err := models.GetWebauthnSessionData(a.db, factor.ID, models.WebauthnRegistration)
+	if err != nil {
+		return badRequestError("No pending WebAuthn registration for this factor").WithInternalError(err).WithCode(ErrorCodeMFAInvalidCode)
+	}
+
+	parsedResponse, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(body))
+	if err != nil {
+		return badRequestError("invalid WebAuthn registration response").WithInternalError(err).WithCode(ErrorCodeMFAInvalidCode)
+	}
+
+	credential, err := web.CreateCredential(&models.WebauthnUser{User: user}, *sessionData, parsedResponse)
+	if err != nil {
+		return badRequestError("error verifying WebAuthn registration").WithInternalError(err).WithCode(ErrorCodeMFAInvalidCode)
+	}
+
+	err = a.db.Transaction(func(tx *storage.Connection) error {
+		record, terr := models.NewWebauthnCredential(factor.ID, credential)
+		if terr != nil {
+			return terr
+		}
+		if terr := tx.Create(record); terr != nil {
+			return terr
+		}
+		if terr := factor.UpdateStatus(tx, models.FactorStateVerified); terr != nil {
+			return terr
+		}
+		if terr := models.NewAuditLogEntry(r, tx, user, models.VerifyFactorAction, r.RemoteAddr, map[string]interface{}{
+			"factor_id": factor.ID,
+		}); terr != nil {
+			return terr
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return sendJSON(w, http.StatusOK, factor)
+}
+
+// finishWebAuthnLogin completes the login ceremony started by
+// ChallengeWebAuthnFactor: it validates the assertion response, updates the
+// credential's stored signature counter, marks the challenge verified, and
+// upgrades the session to AAL2.
+func (a *API) finishWebAuthnLogin(r *http.Request, w http.ResponseWriter, body []byte, web *webauthn.WebAuthn, user *models.User, factor *models.Factor) error {
+	config := a.config
+	currentIP := utilities.GetIPAddress(r)
+
+	params := &VerifyFactorParams{}
+	if err := json.Unmarshal(body, params); err != nil {
+		return badRequestError("invalid body: unable to parse JSON").WithInternalError(err)
+	}
+
+	challenge, err := models.FindChallengeByChallengeID(a.db, params.ChallengeID)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return notFoundError(err.Error())
+		}
+		return internalServerError("Database error finding Challenge").WithInternalError(err)
+	}
+
+	if challenge.VerifiedAt != nil || challenge.IPAddress != currentIP {
+		return badRequestError("Challenge and verify IP addresses mismatch").WithCode(ErrorCodeMFAIPAddressMismatch)
+	}
+
+	hasExpired := time.Now().After(challenge.CreatedAt.Add(time.Second * time.Duration(config.MFA.ChallengeExpiryDuration)))
+	if hasExpired {
+		if terr := a.db.Transaction(func(tx *storage.Connection) error {
+			return tx.Destroy(challenge)
+		}); terr != nil {
+			return internalServerError("Database error deleting challenge").WithInternalError(terr)
+		}
+		return badRequestError("%v has expired, verify against another challenge or create a new challenge.", challenge.ID).WithCode(ErrorCodeMFAChallengeExpired)
+	}
+
+	sessionData, err := models.GetWebauthnSessionData(a.db, factor.ID, models.WebauthnLogin)
+	if err != nil {
+		return badRequestError("No pending WebAuthn login for this factor").WithInternalError(err).WithCode(ErrorCodeMFAInvalidCode)
+	}
+
+	webauthnUser, err := models.NewWebauthnUser(a.db, user)
+	if err != nil {
+		return internalServerError("error loading webauthn credentials").WithInternalError(err)
+	}
+
+	parsedResponse, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(body))
+	if err != nil {
+		return badRequestError("invalid WebAuthn login response").WithInternalError(err).WithCode(ErrorCodeMFAInvalidCode)
 	}
 
-	// if err != nil {
-	//	 Store the credential object
-	// }
+	credential, err := web.ValidateLogin(webauthnUser, *sessionData, parsedResponse)
+	if err != nil {
+		return badRequestError("error verifying WebAuthn login").WithInternalError(err).WithCode(ErrorCodeMFAInvalidCode)
+	}
 
-	return sendJSON(w, http.StatusOK, "")
+	var token *AccessTokenResponse
+	err = a.db.Transaction(func(tx *storage.Connection) error {
+		var terr error
+		if terr = models.NewAuditLogEntry(r, tx, user, models.VerifyFactorAction, r.RemoteAddr, map[string]interface{}{
+			"factor_id":    factor.ID,
+			"challenge_id": challenge.ID,
+		}); terr != nil {
+			return terr
+		}
+		if terr = challenge.Verify(tx); terr != nil {
+			return terr
+		}
+		if terr = models.UpdateWebauthnCredentialSignCount(tx, factor.ID, credential.ID, credential.Authenticator.SignCount); terr != nil {
+			return terr
+		}
+		user, terr = models.FindUserByID(tx, user.ID)
+		if terr != nil {
+			return terr
+		}
+		token, terr = a.updateMFASessionAndClaims(r, tx, user, models.WebAuthnSignIn, models.GrantParams{
+			FactorID: &factor.ID,
+		})
+		if terr != nil {
+			return terr
+		}
+		if terr = a.setCookieTokens(config, token, false, w); terr != nil {
+			return internalServerError("Failed to set JWT cookie. %s", terr)
+		}
+		if terr = models.InvalidateSessionsWithAALLessThan(tx, user.ID, models.AAL2.String()); terr != nil {
+			return internalServerError("Failed to update sessions. %s", terr)
+		}
+		if terr = models.DeleteUnverifiedFactors(tx, user); terr != nil {
+			return internalServerError("Error removing unverified factors. %s", terr)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	metering.RecordLogin(string(models.MFACodeLoginAction), user.ID)
+
+	return sendJSON(w, http.StatusOK, token)
 }
 
 func (a *API) UnenrollFactor(w http.ResponseWriter, r *http.Request) error {
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/netlify/gotrue/conf"
+)
+
+func TestGeneratePhoneOTP(t *testing.T) {
+	otp, err := generatePhoneOTP()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(otp) != phoneOTPLength {
+		t.Fatalf("expected OTP of length %d, got %q", phoneOTPLength, otp)
+	}
+	if strings.TrimRight(otp, "0123456789") != "" {
+		t.Fatalf("expected OTP to be all digits, got %q", otp)
+	}
+}
+
+func TestRecoveryCodesParamsDefaults(t *testing.T) {
+	config := &conf.GlobalConfiguration{}
+
+	count, length := recoveryCodesParams(config)
+	if count != defaultRecoveryCodesCount {
+		t.Fatalf("expected default count %d, got %d", defaultRecoveryCodesCount, count)
+	}
+	if length != defaultRecoveryCodesLength {
+		t.Fatalf("expected default length %d, got %d", defaultRecoveryCodesLength, length)
+	}
+}
+
+func TestRecoveryCodesParamsHonorsConfig(t *testing.T) {
+	config := &conf.GlobalConfiguration{}
+	config.MFA.RecoveryCodes.Count = 20
+	config.MFA.RecoveryCodes.Length = 12
+
+	count, length := recoveryCodesParams(config)
+	if count != 20 {
+		t.Fatalf("expected configured count 20, got %d", count)
+	}
+	if length != 12 {
+		t.Fatalf("expected configured length 12, got %d", length)
+	}
+}
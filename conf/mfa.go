@@ -0,0 +1,57 @@
+package conf
+
+import "time"
+
+// MFAFactorTypeConfiguration controls whether a given MFA factor type accepts
+// new enrollments and/or verification attempts. Splitting the two lets an
+// operator freeze new enrollments for a factor type while still allowing
+// existing users to authenticate with it (or vice versa).
+type MFAFactorTypeConfiguration struct {
+	EnrollEnabled bool `json:"enroll_enabled" split_words:"true"`
+	VerifyEnabled bool `json:"verify_enabled" split_words:"true"`
+}
+
+// TOTPFactorConfiguration is the configuration for the TOTP MFA factor type.
+type TOTPFactorConfiguration struct {
+	MFAFactorTypeConfiguration
+}
+
+// WebAuthnFactorConfiguration is the configuration for the WebAuthn MFA factor
+// type, including the relying party settings gotrue uses when initializing
+// the webauthn library.
+type WebAuthnFactorConfiguration struct {
+	MFAFactorTypeConfiguration
+
+	RPDisplayName string   `json:"rp_display_name" split_words:"true"`
+	RPID          string   `json:"rp_id" split_words:"true"`
+	RPOrigins     []string `json:"rp_origins" split_words:"true"`
+}
+
+// PhoneFactorConfiguration is the configuration for the phone/SMS OTP MFA
+// factor type.
+type PhoneFactorConfiguration struct {
+	MFAFactorTypeConfiguration
+
+	MaxFrequency time.Duration `json:"max_frequency" split_words:"true"`
+}
+
+// RecoveryCodesConfiguration controls how many single-use recovery codes are
+// issued per set, and how long each code is, when a user generates a
+// recovery factor. Defaults to 10 codes of 8 characters each.
+type RecoveryCodesConfiguration struct {
+	Count  int `json:"count" split_words:"true"`
+	Length int `json:"length" split_words:"true"`
+}
+
+// MFAConfiguration holds the settings for gotrue's multi-factor
+// authentication subsystem.
+type MFAConfiguration struct {
+	ChallengeExpiryDuration int64 `json:"challenge_expiry_duration" split_words:"true"`
+	MaxEnrolledFactors      int64 `json:"max_enrolled_factors" split_words:"true"`
+	MaxVerifiedFactors      int   `json:"max_verified_factors" split_words:"true"`
+
+	TOTP          TOTPFactorConfiguration     `json:"totp"`
+	WebAuthn      WebAuthnFactorConfiguration `json:"webauthn"`
+	Phone         PhoneFactorConfiguration    `json:"phone"`
+	RecoveryCodes RecoveryCodesConfiguration  `json:"recovery_codes" split_words:"true"`
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/storage"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Phone is the factor_type value used for phone/SMS OTP MFA factors.
+const Phone = "phone"
+
+// PhoneSignIn is the sign-in method recorded against a session/grant when a
+// user completes a phone OTP login, mirroring TOTPSignIn.
+const PhoneSignIn = "phone"
+
+const PhoneChallengeSentAction = "phone_challenge_sent"
+const PhoneVerifiedAction = "phone_verified"
+
+// PhoneChallenge stores the bcrypt hash of the one-time code sent for a
+// phone MFA challenge, keyed to the Challenge it was issued for.
+type PhoneChallenge struct {
+	ID          uuid.UUID `json:"id" db:"id"`
+	ChallengeID uuid.UUID `json:"challenge_id" db:"challenge_id"`
+	FactorID    uuid.UUID `json:"factor_id" db:"factor_id"`
+	OtpHash     string    `json:"-" db:"otp_hash"`
+
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+func (PhoneChallenge) TableName() string {
+	return "mfa_phone_challenges"
+}
+
+// NewPhoneChallenge hashes otp with bcrypt so the plaintext code is never
+// persisted.
+func NewPhoneChallenge(challengeID, factorID uuid.UUID, otp string) (*PhoneChallenge, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "error generating unique id")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(otp), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, errors.Wrap(err, "error hashing phone otp")
+	}
+
+	return &PhoneChallenge{
+		ID:          id,
+		ChallengeID: challengeID,
+		FactorID:    factorID,
+		OtpHash:     string(hash),
+	}, nil
+}
+
+func FindPhoneChallengeByChallengeID(tx *storage.Connection, challengeID uuid.UUID) (*PhoneChallenge, error) {
+	challenge := &PhoneChallenge{}
+	if err := tx.Where("challenge_id = ?", challengeID).First(challenge); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, PhoneChallengeNotFoundError{}
+		}
+		return nil, errors.Wrap(err, "error finding phone challenge")
+	}
+	return challenge, nil
+}
+
+// FindLatestPhoneChallengeByFactorIDs returns the most recently created
+// phone challenge across the given factor IDs, used to rate-limit how often
+// a new OTP can be requested. Callers should pass every phone factor ID
+// belonging to a user, not just one, so the limit can't be bypassed by
+// enrolling multiple phone factors and round-robining challenges across
+// them.
+func FindLatestPhoneChallengeByFactorIDs(tx *storage.Connection, factorIDs []uuid.UUID) (*PhoneChallenge, error) {
+	if len(factorIDs) == 0 {
+		return nil, PhoneChallengeNotFoundError{}
+	}
+
+	challenge := &PhoneChallenge{}
+	if err := tx.Where("factor_id in (?)", factorIDs).Order("created_at desc").First(challenge); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, PhoneChallengeNotFoundError{}
+		}
+		return nil, errors.Wrap(err, "error finding latest phone challenge")
+	}
+	return challenge, nil
+}
+
+// VerifyOTP compares the submitted code against the stored hash. bcrypt's
+// comparison runs in constant time with respect to the candidate value.
+func (c *PhoneChallenge) VerifyOTP(code string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(c.OtpHash), []byte(code)) == nil
+}
+
+type PhoneChallengeNotFoundError struct{}
+
+func (e PhoneChallengeNotFoundError) Error() string {
+	return "phone challenge not found"
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/gofrs/uuid"
+)
+
+func TestPhoneChallengeVerifyOTP(t *testing.T) {
+	challengeID := uuid.Must(uuid.NewV4())
+	factorID := uuid.Must(uuid.NewV4())
+
+	challenge, err := NewPhoneChallenge(challengeID, factorID, "123456")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !challenge.VerifyOTP("123456") {
+		t.Fatal("expected the original OTP to verify")
+	}
+	if challenge.VerifyOTP("654321") {
+		t.Fatal("expected a mismatched OTP to be rejected")
+	}
+	if challenge.VerifyOTP("") {
+		t.Fatal("expected an empty submitted OTP to be rejected")
+	}
+}
+
+func TestFindLatestPhoneChallengeByFactorIDsEmpty(t *testing.T) {
+	if _, err := FindLatestPhoneChallengeByFactorIDs(nil, nil); err == nil {
+		t.Fatal("expected an error when no factor IDs are given")
+	} else if _, ok := err.(PhoneChallengeNotFoundError); !ok {
+		t.Fatalf("expected a PhoneChallengeNotFoundError, got %T: %v", err, err)
+	}
+}
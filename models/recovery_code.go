@@ -0,0 +1,127 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"math/big"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/storage"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Recovery is the factor_type value used for recovery-code MFA factors.
+const Recovery = "recovery"
+
+// RecoverySignIn is the sign-in method recorded against a session/grant when
+// a user completes a login by redeeming a recovery code, mirroring
+// TOTPSignIn and PhoneSignIn.
+const RecoverySignIn = "recovery"
+
+const RecoveryCodesGeneratedAction = "recovery_codes_generated"
+const RecoveryCodeUsedAction = "recovery_code_used"
+
+// recoveryCodeAlphabet excludes characters that are easily confused with one
+// another (0/O, 1/I) so codes are easier to transcribe by hand.
+const recoveryCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// RecoveryCode stores the bcrypt hash of a single-use MFA recovery code.
+// Codes are linked to the user rather than a specific Challenge, since they
+// are generated ahead of time and redeemed directly against VerifyFactor.
+type RecoveryCode struct {
+	ID       uuid.UUID  `json:"id" db:"id"`
+	UserID   uuid.UUID  `json:"user_id" db:"user_id"`
+	CodeHash string     `json:"-" db:"code_hash"`
+	UsedAt   *time.Time `json:"used_at" db:"used_at"`
+
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+func (RecoveryCode) TableName() string {
+	return "mfa_recovery_codes"
+}
+
+// NewRecoveryCode hashes code with bcrypt so the plaintext value is never
+// persisted; it is only ever shown to the user at generation time.
+func NewRecoveryCode(userID uuid.UUID, code string) (*RecoveryCode, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "error generating unique id")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, errors.Wrap(err, "error hashing recovery code")
+	}
+
+	return &RecoveryCode{
+		ID:       id,
+		UserID:   userID,
+		CodeHash: string(hash),
+	}, nil
+}
+
+// GenerateRecoveryCodes returns count freshly generated recovery codes of
+// length characters each, drawn from recoveryCodeAlphabet. Both count and
+// length must be positive; in particular a non-positive length would
+// silently generate empty-string codes, which bcrypt would treat as a valid
+// hash of the empty string and so accept a blank submitted code.
+func GenerateRecoveryCodes(count, length int) ([]string, error) {
+	if count <= 0 {
+		return nil, errors.New("models: recovery code count must be greater than zero")
+	}
+	if length <= 0 {
+		return nil, errors.New("models: recovery code length must be greater than zero")
+	}
+
+	codes := make([]string, count)
+	for i := range codes {
+		code := make([]byte, length)
+		for j := range code {
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(recoveryCodeAlphabet))))
+			if err != nil {
+				return nil, err
+			}
+			code[j] = recoveryCodeAlphabet[n.Int64()]
+		}
+		codes[i] = string(code)
+	}
+	return codes, nil
+}
+
+// FindValidRecoveryCodesByUser returns the user's unused recovery codes.
+func FindValidRecoveryCodesByUser(tx *storage.Connection, userID uuid.UUID) ([]*RecoveryCode, error) {
+	var codes []*RecoveryCode
+	if err := tx.Where("user_id = ? and used_at is null", userID).All(&codes); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return codes, nil
+		}
+		return nil, errors.Wrap(err, "error finding recovery codes")
+	}
+	return codes, nil
+}
+
+// DeleteRecoveryCodesByUser removes every recovery code belonging to a user,
+// used when a set is regenerated so the old codes stop working immediately.
+func DeleteRecoveryCodesByUser(tx *storage.Connection, userID uuid.UUID) error {
+	if err := tx.RawQuery("delete from "+(&RecoveryCode{}).TableName()+" where user_id = ?", userID).Exec(); err != nil {
+		return errors.Wrap(err, "error deleting recovery codes")
+	}
+	return nil
+}
+
+// VerifyCode compares the submitted code against the stored hash. bcrypt's
+// comparison runs in constant time with respect to the candidate value.
+func (c *RecoveryCode) VerifyCode(code string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(c.CodeHash), []byte(code)) == nil
+}
+
+// MarkUsed records that this recovery code has been redeemed so it cannot
+// be used again.
+func (c *RecoveryCode) MarkUsed(tx *storage.Connection) error {
+	now := time.Now()
+	c.UsedAt = &now
+	return tx.UpdateOnly(c, "used_at")
+}
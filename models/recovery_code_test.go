@@ -0,0 +1,62 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gofrs/uuid"
+)
+
+func TestGenerateRecoveryCodesRejectsNonPositiveCount(t *testing.T) {
+	if _, err := GenerateRecoveryCodes(0, 8); err == nil {
+		t.Fatal("expected an error when count is zero")
+	}
+	if _, err := GenerateRecoveryCodes(-1, 8); err == nil {
+		t.Fatal("expected an error when count is negative")
+	}
+}
+
+func TestGenerateRecoveryCodesRejectsNonPositiveLength(t *testing.T) {
+	if _, err := GenerateRecoveryCodes(10, 0); err == nil {
+		t.Fatal("expected an error when length is zero, otherwise codes would be the empty string")
+	}
+	if _, err := GenerateRecoveryCodes(10, -1); err == nil {
+		t.Fatal("expected an error when length is negative")
+	}
+}
+
+func TestGenerateRecoveryCodesShape(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10, 8)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(codes) != 10 {
+		t.Fatalf("expected 10 codes, got %d", len(codes))
+	}
+	for _, code := range codes {
+		if len(code) != 8 {
+			t.Fatalf("expected code of length 8, got %q", code)
+		}
+		if strings.TrimRight(code, recoveryCodeAlphabet) != "" {
+			t.Fatalf("code %q contains characters outside the recovery code alphabet", code)
+		}
+	}
+}
+
+func TestRecoveryCodeVerifyCode(t *testing.T) {
+	userID := uuid.Must(uuid.NewV4())
+	record, err := NewRecoveryCode(userID, "ABCD1234")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !record.VerifyCode("ABCD1234") {
+		t.Fatal("expected the original code to verify")
+	}
+	if record.VerifyCode("WRONGCODE") {
+		t.Fatal("expected a mismatched code to be rejected")
+	}
+	if record.VerifyCode("") {
+		t.Fatal("expected an empty submitted code to be rejected")
+	}
+}
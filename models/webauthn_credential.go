@@ -0,0 +1,138 @@
+package models
+
+import (
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/storage"
+	"github.com/pkg/errors"
+)
+
+// WebauthnCredential represents a single WebAuthn public key credential bound
+// to an MFA factor. A verified WebAuthn factor may have more than one
+// credential registered against it over its lifetime (e.g. re-registration
+// after losing an authenticator), though gotrue currently creates exactly one
+// per factor at enrollment time.
+type WebauthnCredential struct {
+	ID           uuid.UUID `json:"id" db:"id"`
+	FactorID     uuid.UUID `json:"factor_id" db:"factor_id"`
+	CredentialID string    `json:"credential_id" db:"credential_id"`
+	PublicKey    string    `json:"-" db:"public_key"`
+	AAGUID       string    `json:"aaguid" db:"aaguid"`
+	SignCount    uint32    `json:"sign_count" db:"sign_count"`
+	Transports   string    `json:"transports" db:"transports"`
+
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+func (WebauthnCredential) TableName() string {
+	return "webauthn_credentials"
+}
+
+// NewWebauthnCredential builds the row to persist for a credential returned
+// by a successful webauthn registration ceremony.
+func NewWebauthnCredential(factorID uuid.UUID, credential *webauthn.Credential) (*WebauthnCredential, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "error generating unique id")
+	}
+
+	transports := make([]string, 0, len(credential.Transport))
+	for _, t := range credential.Transport {
+		transports = append(transports, string(t))
+	}
+
+	return &WebauthnCredential{
+		ID:           id,
+		FactorID:     factorID,
+		CredentialID: base64.RawURLEncoding.EncodeToString(credential.ID),
+		PublicKey:    base64.RawURLEncoding.EncodeToString(credential.PublicKey),
+		AAGUID:       base64.RawURLEncoding.EncodeToString(credential.Authenticator.AAGUID),
+		SignCount:    credential.Authenticator.SignCount,
+		Transports:   strings.Join(transports, ","),
+	}, nil
+}
+
+// ToWebauthnCredential decodes a stored row back into the shape the webauthn
+// library expects when validating a login assertion.
+func (wc *WebauthnCredential) ToWebauthnCredential() (webauthn.Credential, error) {
+	credentialID, err := base64.RawURLEncoding.DecodeString(wc.CredentialID)
+	if err != nil {
+		return webauthn.Credential{}, errors.Wrap(err, "error decoding credential id")
+	}
+	publicKey, err := base64.RawURLEncoding.DecodeString(wc.PublicKey)
+	if err != nil {
+		return webauthn.Credential{}, errors.Wrap(err, "error decoding public key")
+	}
+	aaguid, err := base64.RawURLEncoding.DecodeString(wc.AAGUID)
+	if err != nil {
+		return webauthn.Credential{}, errors.Wrap(err, "error decoding aaguid")
+	}
+
+	var transports []protocol.AuthenticatorTransport
+	for _, t := range strings.Split(wc.Transports, ",") {
+		if t != "" {
+			transports = append(transports, protocol.AuthenticatorTransport(t))
+		}
+	}
+
+	return webauthn.Credential{
+		ID:        credentialID,
+		PublicKey: publicKey,
+		Transport: transports,
+		Authenticator: webauthn.Authenticator{
+			AAGUID:    aaguid,
+			SignCount: wc.SignCount,
+		},
+	}, nil
+}
+
+func FindWebauthnCredentialsByFactorID(tx *storage.Connection, factorID uuid.UUID) ([]*WebauthnCredential, error) {
+	var credentials []*WebauthnCredential
+	if err := tx.Where("factor_id = ?", factorID).All(&credentials); err != nil {
+		return nil, errors.Wrap(err, "error finding webauthn credentials")
+	}
+	return credentials, nil
+}
+
+// FindWebauthnCredentialsByUser loads every WebAuthn credential registered
+// against any of the user's factors, regardless of factor status.
+func FindWebauthnCredentialsByUser(tx *storage.Connection, user *User) ([]*WebauthnCredential, error) {
+	factors, err := FindFactorsByUser(tx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	var credentials []*WebauthnCredential
+	for _, factor := range factors {
+		factorCredentials, err := FindWebauthnCredentialsByFactorID(tx, factor.ID)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, factorCredentials...)
+	}
+	return credentials, nil
+}
+
+// UpdateWebauthnCredentialSignCount updates the stored signature counter for
+// the credential used in a login ceremony, so future logins can detect a
+// cloned authenticator.
+func UpdateWebauthnCredentialSignCount(tx *storage.Connection, factorID uuid.UUID, credentialID []byte, signCount uint32) error {
+	encodedID := base64.RawURLEncoding.EncodeToString(credentialID)
+
+	credential := &WebauthnCredential{}
+	if err := tx.Where("factor_id = ? and credential_id = ?", factorID, encodedID).First(credential); err != nil {
+		return errors.Wrap(err, "error finding webauthn credential to update sign count")
+	}
+
+	credential.SignCount = signCount
+	if err := tx.UpdateOnly(credential, "sign_count", "updated_at"); err != nil {
+		return errors.Wrap(err, "error updating webauthn credential sign count")
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/gofrs/uuid"
+)
+
+func TestWebauthnCredentialRoundTrip(t *testing.T) {
+	factorID := uuid.Must(uuid.NewV4())
+	original := &webauthn.Credential{
+		ID:        []byte{1, 2, 3, 4, 5},
+		PublicKey: []byte{6, 7, 8, 9, 10},
+		Transport: []protocol.AuthenticatorTransport{protocol.USB, protocol.Internal},
+		Authenticator: webauthn.Authenticator{
+			AAGUID:    []byte{11, 12, 13, 14},
+			SignCount: 42,
+		},
+	}
+
+	record, err := NewWebauthnCredential(factorID, original)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if record.FactorID != factorID {
+		t.Fatalf("expected factor id %v, got %v", factorID, record.FactorID)
+	}
+
+	roundTripped, err := record.ToWebauthnCredential()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if string(roundTripped.ID) != string(original.ID) {
+		t.Fatalf("expected credential id %v, got %v", original.ID, roundTripped.ID)
+	}
+	if string(roundTripped.PublicKey) != string(original.PublicKey) {
+		t.Fatalf("expected public key %v, got %v", original.PublicKey, roundTripped.PublicKey)
+	}
+	if string(roundTripped.Authenticator.AAGUID) != string(original.Authenticator.AAGUID) {
+		t.Fatalf("expected aaguid %v, got %v", original.Authenticator.AAGUID, roundTripped.Authenticator.AAGUID)
+	}
+	if roundTripped.Authenticator.SignCount != original.Authenticator.SignCount {
+		t.Fatalf("expected sign count %d, got %d", original.Authenticator.SignCount, roundTripped.Authenticator.SignCount)
+	}
+	if len(roundTripped.Transport) != len(original.Transport) {
+		t.Fatalf("expected %d transports, got %d", len(original.Transport), len(roundTripped.Transport))
+	}
+	for i, transport := range original.Transport {
+		if roundTripped.Transport[i] != transport {
+			t.Fatalf("expected transport %v at index %d, got %v", transport, i, roundTripped.Transport[i])
+		}
+	}
+}
+
+func TestWebauthnCredentialRoundTripEmptyTransports(t *testing.T) {
+	factorID := uuid.Must(uuid.NewV4())
+	original := &webauthn.Credential{
+		ID:        []byte{1, 2, 3},
+		PublicKey: []byte{4, 5, 6},
+		Authenticator: webauthn.Authenticator{
+			AAGUID:    []byte{7, 8, 9},
+			SignCount: 1,
+		},
+	}
+
+	record, err := NewWebauthnCredential(factorID, original)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if record.Transports != "" {
+		t.Fatalf("expected empty transports string, got %q", record.Transports)
+	}
+
+	roundTripped, err := record.ToWebauthnCredential()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(roundTripped.Transport) != 0 {
+		t.Fatalf("expected no transports, got %v", roundTripped.Transport)
+	}
+}
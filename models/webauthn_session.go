@@ -0,0 +1,101 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/gofrs/uuid"
+	"github.com/netlify/gotrue/storage"
+	"github.com/pkg/errors"
+)
+
+// WebauthnSessionDataPurpose distinguishes the in-progress ceremony a stored
+// webauthn.SessionData belongs to, since a factor can have at most one
+// pending registration and one pending login at a time.
+type WebauthnSessionDataPurpose string
+
+const (
+	WebauthnRegistration WebauthnSessionDataPurpose = "registration"
+	WebauthnLogin        WebauthnSessionDataPurpose = "login"
+)
+
+// WebauthnSessionData stores the challenge state the webauthn library
+// generates for a registration or login ceremony between the Enroll/
+// Challenge call that starts it and the Verify call that finishes it.
+type WebauthnSessionData struct {
+	ID       uuid.UUID                  `json:"id" db:"id"`
+	FactorID uuid.UUID                  `json:"factor_id" db:"factor_id"`
+	Purpose  WebauthnSessionDataPurpose `json:"purpose" db:"purpose"`
+	Data     string                     `json:"-" db:"data"`
+
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+func (WebauthnSessionData) TableName() string {
+	return "mfa_webauthn_session_data"
+}
+
+// SetWebauthnSessionData persists the SessionData for the given factor and
+// purpose, replacing any previously pending ceremony of the same purpose.
+func SetWebauthnSessionData(tx *storage.Connection, factorID uuid.UUID, purpose WebauthnSessionDataPurpose, sessionData *webauthn.SessionData) error {
+	raw, err := json.Marshal(sessionData)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling webauthn session data")
+	}
+
+	if err := tx.RawQuery(
+		"DELETE FROM "+(&WebauthnSessionData{}).TableName()+" WHERE factor_id = ? AND purpose = ?",
+		factorID, purpose,
+	).Exec(); err != nil {
+		return errors.Wrap(err, "error clearing previous webauthn session data")
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		return errors.Wrap(err, "error generating unique id")
+	}
+
+	record := &WebauthnSessionData{
+		ID:       id,
+		FactorID: factorID,
+		Purpose:  purpose,
+		Data:     string(raw),
+	}
+	return tx.Create(record)
+}
+
+// GetWebauthnSessionData loads and consumes the pending SessionData for the
+// given factor and purpose. It is deleted once read, since a ceremony's
+// challenge must only ever be used once.
+func GetWebauthnSessionData(tx *storage.Connection, factorID uuid.UUID, purpose WebauthnSessionDataPurpose) (*webauthn.SessionData, error) {
+	record := &WebauthnSessionData{}
+	if err := tx.Where("factor_id = ? and purpose = ?", factorID, purpose).First(record); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, WebauthnSessionDataNotFoundError{}
+		}
+		return nil, errors.Wrap(err, "error finding webauthn session data")
+	}
+
+	sessionData := &webauthn.SessionData{}
+	if err := json.Unmarshal([]byte(record.Data), sessionData); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling webauthn session data")
+	}
+
+	if err := tx.Destroy(record); err != nil {
+		return nil, errors.Wrap(err, "error clearing webauthn session data")
+	}
+
+	return sessionData, nil
+}
+
+// WebauthnSessionDataNotFoundError is returned when there is no pending
+// registration or login ceremony for a factor, e.g. because Verify was
+// called without a preceding Enroll/Challenge or the ceremony already
+// completed.
+type WebauthnSessionDataNotFoundError struct{}
+
+func (e WebauthnSessionDataNotFoundError) Error() string {
+	return "webauthn session data not found"
+}
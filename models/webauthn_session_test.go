@@ -0,0 +1,60 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// TestWebauthnSessionDataJSONRoundTrip exercises the same marshal/unmarshal
+// pair SetWebauthnSessionData/GetWebauthnSessionData use internally. A full
+// round trip through the database additionally requires a live storage
+// connection, which isn't available outside an integration test harness, so
+// this isolates the encoding logic that's actually at risk of silently
+// breaking (e.g. if webauthn.SessionData gains fields that don't survive
+// JSON encoding).
+func TestWebauthnSessionDataJSONRoundTrip(t *testing.T) {
+	original := &webauthn.SessionData{
+		Challenge:            "c2FtcGxlLWNoYWxsZW5nZQ",
+		UserID:               []byte{1, 2, 3, 4},
+		AllowedCredentialIDs: [][]byte{{5, 6, 7}, {8, 9, 10}},
+		Expires:              time.Unix(1700000000, 0).UTC(),
+	}
+
+	raw, err := json.Marshal(original)
+	if err != nil {
+		t.Fatalf("unexpected error marshaling session data: %v", err)
+	}
+
+	roundTripped := &webauthn.SessionData{}
+	if err := json.Unmarshal(raw, roundTripped); err != nil {
+		t.Fatalf("unexpected error unmarshaling session data: %v", err)
+	}
+
+	if roundTripped.Challenge != original.Challenge {
+		t.Fatalf("expected challenge %q, got %q", original.Challenge, roundTripped.Challenge)
+	}
+	if string(roundTripped.UserID) != string(original.UserID) {
+		t.Fatalf("expected user id %v, got %v", original.UserID, roundTripped.UserID)
+	}
+	if len(roundTripped.AllowedCredentialIDs) != len(original.AllowedCredentialIDs) {
+		t.Fatalf("expected %d allowed credential ids, got %d", len(original.AllowedCredentialIDs), len(roundTripped.AllowedCredentialIDs))
+	}
+	for i, id := range original.AllowedCredentialIDs {
+		if string(roundTripped.AllowedCredentialIDs[i]) != string(id) {
+			t.Fatalf("expected allowed credential id %v at index %d, got %v", id, i, roundTripped.AllowedCredentialIDs[i])
+		}
+	}
+	if !roundTripped.Expires.Equal(original.Expires) {
+		t.Fatalf("expected expires %v, got %v", original.Expires, roundTripped.Expires)
+	}
+}
+
+func TestWebauthnSessionDataNotFoundError(t *testing.T) {
+	err := WebauthnSessionDataNotFoundError{}
+	if err.Error() == "" {
+		t.Fatal("expected a non-empty error message")
+	}
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/netlify/gotrue/storage"
+)
+
+// WebAuthn is the factor_type value used for WebAuthn MFA factors.
+const WebAuthn = "webauthn"
+
+// WebAuthnSignIn is the sign-in method recorded against a session/grant when
+// a user completes a WebAuthn login ceremony, mirroring TOTPSignIn.
+const WebAuthnSignIn = "webauthn"
+
+// WebauthnUser adapts a gotrue User to the webauthn.User interface the
+// go-webauthn library requires, pairing it with the credentials registered
+// against the user's WebAuthn factors.
+type WebauthnUser struct {
+	*User
+
+	Credentials []webauthn.Credential
+}
+
+// NewWebauthnUser loads a user's existing WebAuthn credentials so it can be
+// passed to webauthn.BeginLogin/ValidateLogin. Use this form whenever
+// credentials may already exist; for a brand new enrollment construct a
+// WebauthnUser directly since there is nothing to load yet.
+func NewWebauthnUser(tx *storage.Connection, user *User) (*WebauthnUser, error) {
+	rows, err := FindWebauthnCredentialsByUser(tx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := make([]webauthn.Credential, 0, len(rows))
+	for _, row := range rows {
+		credential, err := row.ToWebauthnCredential()
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, credential)
+	}
+
+	return &WebauthnUser{User: user, Credentials: credentials}, nil
+}
+
+func (u *WebauthnUser) WebAuthnID() []byte {
+	return []byte(u.ID.String())
+}
+
+func (u *WebauthnUser) WebAuthnName() string {
+	return u.GetEmail()
+}
+
+func (u *WebauthnUser) WebAuthnDisplayName() string {
+	return u.GetEmail()
+}
+
+func (u *WebauthnUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (u *WebauthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.Credentials
+}